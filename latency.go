@@ -0,0 +1,137 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+///////////////////////////
+/// WebSocket Ping-Pong ///
+///////////////////////////
+
+package speedtest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/coder/websocket"
+)
+
+// Defaults and bounds for the “size” and “interval” query parameters
+// accepted by [Speedtest.handleWSLatency]. The bounds exist because this
+// handler isn't covered by “max_download”/“max_rate”: without them, a
+// client could force a multi-gigabyte per-connection allocation with
+// “size”, or turn the server-ping ticker into a busy loop with “interval”.
+const (
+	defaultWSPingSize     = 32
+	minWSPingSize         = 1
+	maxWSPingSize         = 64 * 1024
+	defaultWSPingInterval = 1 * time.Second
+	minWSPingInterval     = 10 * time.Millisecond
+	maxWSPingInterval     = 1 * time.Minute
+)
+
+// “isWebSocketUpgrade” reports whether “r” is asking to be upgraded to a
+// WebSocket connection.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// “handleWSLatency” upgrades “r” to a WebSocket connection and runs a
+// ping-pong loop over it: every binary frame received from the client is
+// echoed straight back (so the client can compute RTT samples), and a
+// server-initiated ping frame is sent on a fixed interval.
+func (m Speedtest) handleWSLatency(w http.ResponseWriter, r *http.Request) error {
+	size := defaultWSPingSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < minWSPingSize || n > maxWSPingSize {
+			return caddyhttp.Error(
+				http.StatusBadRequest,
+				fmt.Errorf(
+					"\"size\" query parameter %q must be between %d and %d",
+					s, minWSPingSize, maxWSPingSize,
+				),
+			)
+		}
+		size = n
+	}
+
+	interval := defaultWSPingInterval
+	if s := r.URL.Query().Get("interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minWSPingInterval || d > maxWSPingInterval {
+			return caddyhttp.Error(
+				http.StatusBadRequest,
+				fmt.Errorf(
+					"\"interval\" query parameter %q must be between %s and %s",
+					s, minWSPingInterval, maxWSPingInterval,
+				),
+			)
+		}
+		interval = d
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return caddyhttp.Error(
+			http.StatusInternalServerError,
+			fmt.Errorf("failed to accept websocket connection: %v", err),
+		)
+	}
+	defer conn.CloseNow()
+
+	ctx := r.Context()
+
+	// “websocket.Conn” only guarantees safety for one concurrent reader and
+	// one concurrent writer; the echo goroutine below and the server-ping
+	// ticker in the main loop both write, so every write is serialized
+	// through “writeMu” to avoid corrupting frames on the wire.
+	var writeMu sync.Mutex
+
+	// Echo every frame the client sends us, on its own goroutine so that we
+	// can also drive the server-initiated ping ticker below.
+	echoErr := make(chan error, 1)
+	go func() {
+		for {
+			msgType, data, err := conn.Read(ctx)
+			if err != nil {
+				echoErr <- err
+				return
+			}
+			writeMu.Lock()
+			err = conn.Write(ctx, msgType, data)
+			writeMu.Unlock()
+			if err != nil {
+				echoErr <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ping := make([]byte, size)
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return nil
+		case <-echoErr:
+			return nil
+		case <-ticker.C:
+			writeMu.Lock()
+			err := conn.Write(ctx, websocket.MessageBinary, ping)
+			writeMu.Unlock()
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+///////////////////////////
+/// WebSocket Ping-Pong ///
+///////////////////////////
+
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// “TestPing” checks the “ping” query parameter returns a server timestamp
+// and echoes back “client-time”.
+func TestPing(t *testing.T) {
+	tester := testSetup(t)
+
+	resp, err := tester.Client.Get(
+		fmt.Sprint(urlAuthority, "/speedtest?ping=1&client-time=12345"),
+	)
+	if err != nil {
+		t.Fatalf("failed to send ping request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		t.Fatalf("expected status 204, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Server-Time-Ns") == "" {
+		t.Fatalf("missing X-Server-Time-Ns header")
+	}
+	if resp.Header.Get("X-Client-Time") != "12345" {
+		t.Fatalf("expected X-Client-Time to echo 12345, got %q", resp.Header.Get("X-Client-Time"))
+	}
+}
+
+// “TestWSLatencyEcho” dials the WebSocket latency endpoint, sends a binary
+// frame, and checks that it's echoed back intact, and that a
+// server-initiated ping frame arrives within the configured interval.
+func TestWSLatencyEcho(t *testing.T) {
+	testSetupWithOptions(t, "ws_latency /speedtest")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(
+		ctx,
+		"ws://localhost:8080/speedtest?size=16&interval=50ms",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer conn.CloseNow()
+
+	payload := getRandBytes(t, 128)
+	start := time.Now()
+	if err := conn.Write(ctx, websocket.MessageBinary, payload); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	// The echoed frame and the first server-initiated ping are distinct
+	// sizes (128 vs. 16 bytes), but their relative arrival order isn't
+	// guaranteed: the 50ms ticker races the echo round-trip, so on a slow
+	// or loaded run the ping could arrive first. Identify each frame by its
+	// size rather than assuming an order.
+	var rtt time.Duration
+	var sawEcho, sawPing bool
+	for i := 0; i < 2; i++ {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		switch len(data) {
+		case len(payload):
+			if string(data) != string(payload) {
+				t.Fatalf("echoed frame does not match: got %d bytes, want %d bytes", len(data), len(payload))
+			}
+			rtt = time.Since(start)
+			sawEcho = true
+		case 16:
+			sawPing = true
+		default:
+			t.Fatalf("unexpected frame of %d bytes", len(data))
+		}
+	}
+
+	if !sawEcho {
+		t.Fatalf("never received the echoed frame")
+	}
+	if !sawPing {
+		t.Fatalf("never received a server-initiated ping")
+	}
+	if rtt > time.Second {
+		t.Fatalf("echo took too long: %v", rtt)
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// “TestWSLatencyOutOfRange” checks that “size” and “interval” values
+// outside the handler's bounds are rejected with a 400, rather than being
+// honored as an unbounded per-connection allocation or a busy-loop ticker.
+func TestWSLatencyOutOfRange(t *testing.T) {
+	testSetupWithOptions(t, "ws_latency /speedtest")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name  string
+		query string
+	}{
+		{"size too large", "size=100000000"},
+		{"interval too small", "interval=1ns"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, resp, err := websocket.Dial(
+				ctx,
+				fmt.Sprint("ws://localhost:8080/speedtest?", tc.query),
+				nil,
+			)
+			if err == nil {
+				t.Fatalf("expected websocket dial to fail")
+			}
+			if resp == nil || resp.StatusCode != 400 {
+				t.Fatalf("expected a 400 response, got %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+///////////////////
+/// Size Limits ///
+///////////////////
+
+package speedtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddytest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// “testSetupWithOptions” is like [testSetup], but lets the caller supply
+// subdirectives for the “speedtest” block.
+func testSetupWithOptions(t testing.TB, options string) *caddytest.Tester {
+	zap.RedirectStdLogAt(caddy.Log(), zapcore.DebugLevel)
+
+	tester := caddytest.NewTester(t)
+	tester.InitServer(
+		fmt.Sprintf(
+			`{
+				skip_install_trust
+				admin localhost:%d
+
+				log {
+					level ERROR
+					format console
+				}
+			}
+
+			%s {
+				speedtest /speedtest {
+					%s
+				}
+				handle_errors {
+					header Content-Type "text/plain; charset=utf-8"
+					respond "{err.status_code} {err.status_text}: {err.message}"
+				}
+			}`,
+			caddytest.Default.AdminPort, urlAuthority, options,
+		),
+		"caddyfile",
+	)
+	return tester
+}
+
+// “TestMaxDownload” checks that a download larger than “max_download” is
+// rejected with a 413.
+func TestMaxDownload(t *testing.T) {
+	tester := testSetupWithOptions(t, "max_download 1kB")
+
+	tester.AssertGetResponse(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=1kB"),
+		200,
+		string(getRandBytes(t, 1000)),
+	)
+
+	tester.AssertGetResponse(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=2kB"),
+		413,
+		"413 Request Entity Too Large: requested 2000 bytes exceeds max_download of 1000 bytes",
+	)
+}
+
+// “TestMaxUpload” checks that an upload larger than “max_upload” is rejected
+// with a 413.
+func TestMaxUpload(t *testing.T) {
+	tester := testSetupWithOptions(t, "max_upload 1kB")
+
+	tester.AssertPostResponseBody(
+		fmt.Sprint(urlAuthority, "/speedtest"),
+		[]string{"Content-Type: application/octet-stream"},
+		bytes.NewBuffer(getRandBytes(t, 1000)),
+		200,
+		"Received 1.0 kB.\n",
+	)
+
+	resp, _ := tester.AssertPostResponseBody(
+		fmt.Sprint(urlAuthority, "/speedtest"),
+		[]string{"Content-Type: application/octet-stream"},
+		bytes.NewBuffer(getRandBytes(t, 2000)),
+		413,
+		"",
+	)
+	if resp.StatusCode != 413 {
+		t.Fatalf("expected status 413, got %d", resp.StatusCode)
+	}
+}
+
+// “TestMaxRate” checks that “max_rate” actually throttles a download: a
+// transfer of twice the configured rate must take at least as long as one
+// full refill interval of the token bucket.
+func TestMaxRate(t *testing.T) {
+	tester := testSetupWithOptions(t, "max_rate 20kB/s")
+
+	start := time.Now()
+	resp, err := tester.Client.Get(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=40kB"),
+	)
+	if err != nil {
+		t.Fatalf("failed to download: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if n != 40_000 {
+		t.Fatalf("expected 40000 bytes, got %d", n)
+	}
+
+	// The burst (one rate's worth of bytes) is served immediately, but the
+	// remaining half of the transfer must wait out a full refill, so this
+	// should take at least ~1 second at 20 kB/s.
+	if elapsed < 800*time.Millisecond {
+		t.Fatalf("expected max_rate to throttle the transfer, took only %v", elapsed)
+	}
+}
+
+// “TestMaxConcurrent” checks that more than “max_concurrent” requests in
+// flight at once are rejected with a 429.
+func TestMaxConcurrent(t *testing.T) {
+	tester := testSetupWithOptions(t, "max_concurrent 1")
+
+	// [http.Client.Get] returns as soon as the response headers arrive,
+	// which for “handleGet” only happens once the handler has acquired the
+	// semaphore slot and started streaming. Deliberately leaving its body
+	// unread keeps the server blocked on the (unread) write and the slot
+	// held, so the second request below is guaranteed to overlap with the
+	// first — firing both from goroutines and asserting a status mix, as
+	// an earlier version of this test did, raced a fast loopback transfer
+	// that could finish before the second request was even dispatched.
+	resp1, err := tester.Client.Get(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=50MB"),
+	)
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	defer resp1.Body.Close()
+
+	resp2, err := tester.Client.Get(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=50MB"),
+	)
+	if err != nil {
+		t.Fatalf("second request failed: %v", err)
+	}
+	defer resp2.Body.Close()
+
+	if resp1.StatusCode != http.StatusOK {
+		t.Fatalf("expected first request to succeed, got %d", resp1.StatusCode)
+	}
+	if resp2.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected second request to be rejected with 429, got %d", resp2.StatusCode)
+	}
+
+	if _, err := io.Copy(io.Discard, resp1.Body); err != nil {
+		t.Fatalf("failed to drain first response body: %v", err)
+	}
+}
+
+// “TestMethods” checks that “methods” restricts the accepted HTTP methods.
+func TestMethods(t *testing.T) {
+	tester := testSetupWithOptions(t, "methods GET")
+
+	tester.AssertGetResponse(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=1kB"),
+		200,
+		string(getRandBytes(t, 1000)),
+	)
+
+	tester.AssertPostResponseBody(
+		fmt.Sprint(urlAuthority, "/speedtest"),
+		[]string{"Content-Type: application/octet-stream"},
+		bytes.NewBuffer(getRandBytes(t, 1000)),
+		405,
+		`405 Method Not Allowed: method "POST" is not allowed`,
+	)
+}
@@ -0,0 +1,174 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+//////////////////
+/// Prometheus ///
+//////////////////
+
+package speedtest
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metricsRegistrationMu guards [initMetrics] so that the package's
+// collectors are only ever registered once per process, even though
+// [Speedtest.Provision] may run once per configured handler.
+var metricsRegistrationMu sync.Mutex
+
+// The package's Prometheus collectors. These are “nil” until [initMetrics]
+// has run.
+var (
+	downloadBytesTotal  *prometheus.CounterVec
+	uploadBytesTotal    *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	inFlightRequests    prometheus.Gauge
+	throughputHistogram *prometheus.HistogramVec
+)
+
+// “initMetrics” registers the package's Prometheus collectors against “reg”
+// the first time it's called; later calls are no-ops. This lets
+// [Speedtest.Provision] call it unconditionally for every configured
+// “speedtest” handler without panicking on a duplicate registration.
+func initMetrics(reg prometheus.Registerer) {
+	metricsRegistrationMu.Lock()
+	defer metricsRegistrationMu.Unlock()
+
+	if downloadBytesTotal != nil {
+		return
+	}
+
+	factory := promauto.With(reg)
+
+	downloadBytesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "caddy",
+		Subsystem: "speedtest",
+		Name:      "download_bytes_total",
+		Help:      "Total number of bytes sent to clients by the speedtest handler.",
+	}, []string{"ip_class", "proto", "status"})
+
+	uploadBytesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "caddy",
+		Subsystem: "speedtest",
+		Name:      "upload_bytes_total",
+		Help:      "Total number of bytes received from clients by the speedtest handler.",
+	}, []string{"ip_class", "proto", "status"})
+
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "caddy",
+		Subsystem: "speedtest",
+		Name:      "request_duration_seconds",
+		Help:      "Time spent serving a speedtest request, from first byte to last.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "proto", "status"})
+
+	inFlightRequests = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: "caddy",
+		Subsystem: "speedtest",
+		Name:      "in_flight",
+		Help:      "Number of speedtest requests currently being served.",
+	})
+
+	throughputHistogram = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "caddy",
+		Subsystem: "speedtest",
+		Name:      "throughput_bytes_per_second",
+		Help:      "Measured throughput of completed speedtest transfers.",
+		Buckets: []float64{
+			1_000_000,
+			10_000_000,
+			50_000_000,
+			100_000_000,
+			250_000_000,
+			500_000_000,
+			1_000_000_000,
+		},
+	}, []string{"direction"})
+}
+
+// “ipClass” buckets a “RemoteAddr” into a coarse class for use as a metric
+// label, so that a hostile client can't blow up our cardinality by hitting
+// us from a new source port (or address) on every request.
+func ipClass(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "unknown"
+	case ip.To4() != nil:
+		return "ipv4"
+	default:
+		return "ipv6"
+	}
+}
+
+// “observeRequest” records the Prometheus metrics for a single completed
+// “download” or “upload”, given the request, the number of bytes
+// transferred, the resulting status code, and the time the transfer began.
+func observeRequest(r *http.Request, direction string, status int, nBytes int64, start time.Time) {
+	proto := r.Proto
+	class := ipClass(r.RemoteAddr)
+	statusStr := strconv.Itoa(status)
+	elapsed := time.Since(start)
+
+	requestDuration.WithLabelValues(r.Method, proto, statusStr).Observe(elapsed.Seconds())
+
+	switch direction {
+	case "download":
+		downloadBytesTotal.WithLabelValues(class, proto, statusStr).Add(float64(nBytes))
+	case "upload":
+		uploadBytesTotal.WithLabelValues(class, proto, statusStr).Add(float64(nBytes))
+	}
+
+	if nBytes > 0 && elapsed > 0 {
+		throughputHistogram.WithLabelValues(direction).Observe(float64(nBytes) / elapsed.Seconds())
+	}
+}
+
+///////////////////////
+/// Response Writer ///
+///////////////////////
+
+// “instrumentedResponseWriter” wraps [http.ResponseWriter] to record the
+// status code and number of bytes written, so that [handleGet] can report
+// accurate metrics even when serving a partial (“Range”) response.
+type instrumentedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// “WriteHeader” implements [http.ResponseWriter.WriteHeader], recording the
+// status code as it's written.
+func (w *instrumentedResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// “Write” implements [io.Writer], recording the number of bytes written.
+func (w *instrumentedResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Interface guards
+var (
+	_ http.ResponseWriter = (*instrumentedResponseWriter)(nil)
+)
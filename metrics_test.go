@@ -0,0 +1,152 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+//////////////////
+/// Prometheus ///
+//////////////////
+
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddytest"
+)
+
+// “scrapeMetrics” fetches and returns the body of the admin “/metrics”
+// endpoint.
+func scrapeMetrics(t testing.TB, tester *caddytest.Tester) string {
+	resp, err := tester.Client.Get(
+		fmt.Sprintf("http://localhost:%d/metrics", caddytest.Default.AdminPort),
+	)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics response: %v", err)
+	}
+
+	return string(body)
+}
+
+// “sumMetric” sums the values of every exposition-format sample line whose
+// metric name is “name”, across all of its label combinations. This is used
+// to check that a counter advanced by a specific amount rather than just
+// that its metric family is present in the scrape.
+func sumMetric(t testing.TB, metrics, name string) float64 {
+	t.Helper()
+
+	var total float64
+	scanner := bufio.NewScanner(strings.NewReader(metrics))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, name+"{") && !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			t.Fatalf("failed to parse value of metric line %q: %v", line, err)
+		}
+		total += value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to scan metrics: %v", err)
+	}
+
+	return total
+}
+
+// “TestMetrics” performs a download and an upload, then scrapes the admin
+// metrics endpoint before and after and asserts that the byte counters
+// advanced by exactly the number of bytes transferred, and that the
+// remaining collectors are present.
+func TestMetrics(t *testing.T) {
+	tester := testSetup(t)
+
+	before := scrapeMetrics(t, tester)
+	downloadBefore := sumMetric(t, before, "caddy_speedtest_download_bytes_total")
+	uploadBefore := sumMetric(t, before, "caddy_speedtest_upload_bytes_total")
+
+	tester.AssertGetResponse(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=10kB"),
+		200,
+		string(getRandBytes(t, 10_000)),
+	)
+
+	postBody := getRandBytes(t, 10_000)
+	tester.AssertPostResponseBody(
+		fmt.Sprint(urlAuthority, "/speedtest"),
+		[]string{"Content-Type: application/octet-stream"},
+		bytes.NewBuffer(postBody),
+		200,
+		"Received 10 kB.\n",
+	)
+
+	metrics := scrapeMetrics(t, tester)
+
+	for _, want := range []string{
+		"caddy_speedtest_request_duration_seconds",
+		"caddy_speedtest_in_flight",
+		"caddy_speedtest_throughput_bytes_per_second",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("metrics response is missing %q", want)
+		}
+	}
+
+	if got, want := sumMetric(t, metrics, "caddy_speedtest_download_bytes_total")-downloadBefore, float64(10_000); got != want {
+		t.Fatalf("caddy_speedtest_download_bytes_total advanced by %v bytes, want %v", got, want)
+	}
+	if got, want := sumMetric(t, metrics, "caddy_speedtest_upload_bytes_total")-uploadBefore, float64(10_000); got != want {
+		t.Fatalf("caddy_speedtest_upload_bytes_total advanced by %v bytes, want %v", got, want)
+	}
+}
+
+// “TestMetricsDisabled” configures a handler with “metrics off” and checks
+// that requests still succeed.
+func TestMetricsDisabled(t *testing.T) {
+	tester := caddytest.NewTester(t)
+	tester.InitServer(
+		fmt.Sprintf(
+			`{
+				skip_install_trust
+				admin localhost:%d
+
+				log {
+					level ERROR
+					format console
+				}
+			}
+
+			%s {
+				speedtest /speedtest {
+					metrics off
+				}
+			}`,
+			caddytest.Default.AdminPort, urlAuthority,
+		),
+		"caddyfile",
+	)
+
+	tester.AssertGetResponse(
+		fmt.Sprint(urlAuthority, "/speedtest?bytes=1kB"),
+		200,
+		string(getRandBytes(t, 1000)),
+	)
+}
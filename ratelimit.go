@@ -0,0 +1,68 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+/////////////////////
+/// Rate Limiting ///
+/////////////////////
+
+package speedtest
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedChunkBytes bounds how much a single [rateLimitedReadSeeker.Read]
+// call will return, so that the underlying [rate.Limiter]'s burst size stays
+// proportional to the configured rate rather than to the caller's buffer
+// size.
+const rateLimitedChunkBytes = 64 * 1024
+
+// “rateLimitedReadSeeker” wraps an [io.ReadSeeker], using a token-bucket
+// [rate.Limiter] to cap the rate at which it can be read.
+type rateLimitedReadSeeker struct {
+	io.ReadSeeker
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+// “newRateLimitedReadSeeker” wraps “rs” such that reads from it are capped
+// to “bytesPerSec” bytes per second. “ctx” should be the serving request's
+// context, so that a disconnected client doesn't leave the handler (and the
+// “MaxConcurrent” slot it holds) blocked in [rate.Limiter.WaitN] for as long
+// as the configured rate implies.
+func newRateLimitedReadSeeker(ctx context.Context, rs io.ReadSeeker, bytesPerSec uint64) *rateLimitedReadSeeker {
+	burst := min(bytesPerSec, rateLimitedChunkBytes)
+	return &rateLimitedReadSeeker{
+		ReadSeeker: rs,
+		ctx:        ctx,
+		limiter:    rate.NewLimiter(rate.Limit(bytesPerSec), int(burst)),
+	}
+}
+
+// “Read” implements [io.Reader]. It reads at most the limiter's burst size
+// at a time, and blocks until the token bucket has enough tokens for the
+// bytes actually read, or until “ctx” is done.
+func (r *rateLimitedReadSeeker) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.ReadSeeker.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// Interface guards
+var (
+	_ io.ReadSeeker = (*rateLimitedReadSeeker)(nil)
+)
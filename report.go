@@ -0,0 +1,102 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+////////////////////////////
+/// Transport Reporting ///
+////////////////////////////
+
+package speedtest
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// “transportReport” is the JSON body returned by the “report” query
+// parameter. It describes the transport that carried the request, and, for
+// uploads, how much data was received and how long that took.
+type transportReport struct {
+	ALPN          string `json:"alpn"`
+	ProtoMajor    int    `json:"proto_major"`
+	ProtoMinor    int    `json:"proto_minor"`
+	CipherSuite   string `json:"cipher_suite,omitempty"`
+	RemoteAddr    string `json:"remote_addr"`
+	ReceivedBytes int64  `json:"received_bytes,omitempty"`
+	DurationMs    int64  `json:"duration_ms,omitempty"`
+
+	// ZeroRTT reports whether the request arrived over a 0-RTT (early-data)
+	// QUIC connection. It's deliberately a pointer, encoded without
+	// “omitempty”, so that a client can tell "unknown" (“null”) apart from
+	// "confirmed not 0-RTT" (“false”): “r.TLS” (a [tls.ConnectionState]) has
+	// no early-data field, and “DidResume” alone doesn't tell us whether any
+	// data actually arrived as early data, so this can only be answered from
+	// the underlying QUIC connection's state, which isn't threaded through
+	// “net/http” itself. [zeroRTTFromContext] is the extension point for
+	// wiring that in from Caddy's HTTP/3 listener; until some caller
+	// populates it, every report honestly states "null" rather than
+	// guessing.
+	ZeroRTT *bool `json:"zero_rtt"`
+}
+
+// zeroRTTContextKey is the context key a caller further down the HTTP/3
+// stack (e.g. Caddy's QUIC listener) would set to report 0-RTT use for
+// [zeroRTTFromContext] to read. Nothing in this module sets it today.
+type zeroRTTContextKey struct{}
+
+// “zeroRTTFromContext” reads whether “r” arrived over a 0-RTT QUIC
+// connection from its context, returning “nil” if that information isn't
+// present — which, absent the wiring described on [zeroRTTContextKey], is
+// always the case today.
+func zeroRTTFromContext(r *http.Request) *bool {
+	used, ok := r.Context().Value(zeroRTTContextKey{}).(bool)
+	if !ok {
+		return nil
+	}
+	return &used
+}
+
+// “newTransportReport” builds a [transportReport] describing “r”.
+// “receivedBytes” and “duration” are only meaningful for uploads; callers
+// handling plain “GET” requests should pass zero values.
+func newTransportReport(r *http.Request, receivedBytes int64, duration time.Duration) transportReport {
+	report := transportReport{
+		ProtoMajor:    r.ProtoMajor,
+		ProtoMinor:    r.ProtoMinor,
+		RemoteAddr:    r.RemoteAddr,
+		ReceivedBytes: receivedBytes,
+		ZeroRTT:       zeroRTTFromContext(r),
+	}
+
+	if duration > 0 {
+		report.DurationMs = duration.Milliseconds()
+	}
+
+	if r.TLS != nil {
+		report.ALPN = r.TLS.NegotiatedProtocol
+		report.CipherSuite = tls.CipherSuiteName(r.TLS.CipherSuite)
+	}
+
+	return report
+}
+
+// “writeReport” writes “report” as the JSON response body.
+func writeReport(w http.ResponseWriter, report transportReport) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(report)
+}
+
+// “altSvcHeaderValue” builds the “Alt-Svc” header value advertising HTTP/3
+// support on the port named in the request's “Host”, or on 443 if “Host”
+// names no port.
+func altSvcHeaderValue(r *http.Request) string {
+	port := "443"
+	if _, p, err := net.SplitHostPort(r.Host); err == nil && p != "" {
+		port = p
+	}
+	return `h3=":` + port + `"; ma=86400`
+}
@@ -0,0 +1,82 @@
+// Caddy Speedtest
+// https://maxchernoff.ca/tools/speedtest
+// SPDX-License-Identifier: Apache-2.0+
+// SPDX-FileCopyrightText: 2025 Max Chernoff
+
+////////////////////////////
+/// Transport Reporting ///
+////////////////////////////
+
+package speedtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// “TestReportGet” checks that “?report=1” on a “GET” request returns a JSON
+// transport report.
+func TestReportGet(t *testing.T) {
+	tester := testSetup(t)
+
+	resp, err := tester.Client.Get(
+		fmt.Sprint(urlAuthority, "/speedtest?report=1"),
+	)
+	if err != nil {
+		t.Fatalf("failed to send report request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var report transportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+
+	if report.ProtoMajor == 0 {
+		t.Fatalf("expected a non-zero ProtoMajor, got %+v", report)
+	}
+	if report.RemoteAddr == "" {
+		t.Fatalf("expected a non-empty RemoteAddr, got %+v", report)
+	}
+	if report.ZeroRTT != nil {
+		t.Fatalf("expected a nil ZeroRTT over a plain TCP connection, got %v", *report.ZeroRTT)
+	}
+}
+
+// “TestReportPost” checks that “?report=1” on a “POST” request returns a
+// JSON transport report that includes the received byte count.
+func TestReportPost(t *testing.T) {
+	tester := testSetup(t)
+
+	postBody := getRandBytes(t, 1000)
+	resp, err := tester.Client.Post(
+		fmt.Sprint(urlAuthority, "/speedtest?report=1"),
+		"application/octet-stream",
+		bytes.NewBuffer(postBody),
+	)
+	if err != nil {
+		t.Fatalf("failed to send report request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read report response: %v", err)
+	}
+
+	var report transportReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatalf("failed to decode report %q: %v", body, err)
+	}
+
+	if report.ReceivedBytes != 1000 {
+		t.Fatalf("expected ReceivedBytes 1000, got %d", report.ReceivedBytes)
+	}
+}
@@ -10,10 +10,14 @@
 package speedtest
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
@@ -33,7 +37,55 @@ func init() {
 }
 
 // [Speedtest] implements an HTTP handler that performs speed tests.
-type Speedtest struct{}
+type Speedtest struct {
+	// Metrics controls whether Prometheus metrics are emitted for this
+	// handler's transfers. Defaults to “true”; set to “false” with
+	// “metrics off” in the Caddyfile.
+	Metrics *bool `json:"metrics,omitempty"`
+
+	// MaxDownloadBytes limits the size of a single “GET” transfer, in bytes.
+	// Requests for more than this are rejected with a 413. Zero means no
+	// limit.
+	MaxDownloadBytes uint64 `json:"max_download_bytes,omitempty"`
+
+	// MaxUploadBytes limits the size of a single “POST” body, in bytes.
+	// Bodies larger than this are rejected with a 413. Zero means no
+	// limit.
+	MaxUploadBytes uint64 `json:"max_upload_bytes,omitempty"`
+
+	// MaxRateBytesPerSec limits the rate at which a single “GET” response
+	// is served, in bytes per second. “POST” uploads are not limited. Zero
+	// means no limit.
+	MaxRateBytesPerSec uint64 `json:"max_rate_bytes_per_sec,omitempty"`
+
+	// MaxConcurrent limits the number of speedtest requests that may be in
+	// flight at once, across all clients. Zero means no limit.
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+
+	// AllowedMethods restricts which HTTP methods are accepted. If empty,
+	// both “GET” and “POST” are allowed.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+
+	// WSLatencyPath controls whether this handler accepts WebSocket
+	// ping-pong connections for latency/jitter measurement, and at which
+	// path. It's “nil” (disabled) unless “ws_latency” is set in the
+	// Caddyfile; a non-nil empty string means WebSocket upgrades are
+	// accepted at any path handled by this instance, and a non-empty value
+	// restricts them to that exact path. Unlike “Metrics”, which is on
+	// unless “metrics off” is given, this is opt-in, since this handler
+	// has no way to turn a sustained, resource-holding connection type back
+	// off once it's accepted at every path by default.
+	WSLatencyPath *string `json:"ws_latency_path,omitempty"`
+
+	// AdvertiseH3 controls whether an “Alt-Svc” header is sent on “GET”
+	// responses served over TCP, advertising HTTP/3 support so that
+	// clients can migrate to QUIC for their next request.
+	AdvertiseH3 bool `json:"advertise_h3,omitempty"`
+
+	// sem enforces MaxConcurrent. It's provisioned in [Speedtest.Provision]
+	// and is nil when MaxConcurrent is zero.
+	sem chan struct{}
+}
 
 // “CaddyModule” returns the Caddy module information.
 func (Speedtest) CaddyModule() caddy.ModuleInfo {
@@ -63,21 +115,132 @@ func (m *Speedtest) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	if d.Next() { // Any arguments?
 		return fmt.Errorf(`"speedtest" takes no arguments`)
 	}
+
+	for d.NextBlock(0) {
+		switch d.Val() {
+		case "metrics":
+			enabled := true
+			if d.NextArg() {
+				if d.Val() != "off" {
+					return fmt.Errorf(`unrecognized "metrics" argument %q`, d.Val())
+				}
+				enabled = false
+			}
+			m.Metrics = &enabled
+		case "max_download":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := humanize.ParseBytes(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid max_download value %q: %v", d.Val(), err)
+			}
+			m.MaxDownloadBytes = n
+		case "max_upload":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := humanize.ParseBytes(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid max_upload value %q: %v", d.Val(), err)
+			}
+			m.MaxUploadBytes = n
+		case "max_rate":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := humanize.ParseBytes(strings.TrimSuffix(d.Val(), "/s"))
+			if err != nil {
+				return fmt.Errorf("invalid max_rate value %q: %v", d.Val(), err)
+			}
+			m.MaxRateBytesPerSec = n
+		case "max_concurrent":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := strconv.Atoi(d.Val())
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid max_concurrent value %q", d.Val())
+			}
+			m.MaxConcurrent = n
+		case "methods":
+			var methods []string
+			for d.NextArg() {
+				methods = append(methods, d.Val())
+			}
+			if len(methods) == 0 {
+				return d.ArgErr()
+			}
+			m.AllowedMethods = methods
+		case "ws_latency":
+			path := ""
+			if d.NextArg() {
+				path = d.Val()
+			}
+			m.WSLatencyPath = &path
+		case "advertise_h3":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			m.AdvertiseH3 = true
+		default:
+			return fmt.Errorf("unrecognized subdirective %q", d.Val())
+		}
+	}
+
 	return nil
 }
 
-// “Provision” implements [caddy.Provisioner]. We don't have any setup to do,
-// so this is a no-op.
+// “metricsEnabled” reports whether this handler should emit Prometheus
+// metrics. Metrics are enabled unless explicitly disabled with
+// “metrics off”.
+func (m Speedtest) metricsEnabled() bool {
+	return m.Metrics == nil || *m.Metrics
+}
+
+// “Provision” implements [caddy.Provisioner]. It registers the package's
+// Prometheus collectors against Caddy's metrics registry and sets up the
+// semaphore used to enforce “MaxConcurrent”.
 func (m *Speedtest) Provision(ctx caddy.Context) error {
+	if m.metricsEnabled() {
+		initMetrics(ctx.GetMetricsRegistry())
+	}
+	if m.MaxConcurrent > 0 {
+		m.sem = make(chan struct{}, m.MaxConcurrent)
+	}
 	return nil
 }
 
-// “Validate” implements [caddy.Validator]. We don't have any configuration
-// to validate, so this is a no-op.
+// “Validate” implements [caddy.Validator]. It checks that “AllowedMethods”
+// only contains methods we actually support, and that “MaxConcurrent” is
+// non-negative.
+//
+// The Caddyfile parser already rejects a negative “max_concurrent”, but
+// “Validate” also has to catch it because JSON-configured instances (e.g.
+// via the admin API) skip the Caddyfile parser entirely; left unchecked, a
+// negative value would silently disable the concurrency cap, since
+// [Speedtest.Provision] only provisions the semaphore when
+// “MaxConcurrent > 0”.
 func (m *Speedtest) Validate() error {
+	for _, method := range m.AllowedMethods {
+		if method != http.MethodGet && method != http.MethodPost {
+			return fmt.Errorf("unsupported method %q in allowed_methods", method)
+		}
+	}
+	if m.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative, got %d", m.MaxConcurrent)
+	}
 	return nil
 }
 
+// “matchesWSLatencyPath” reports whether “r” is eligible to be handled as a
+// WebSocket latency connection, i.e. “ws_latency” was configured for this
+// handler, and either it was configured with no path (match any) or “r” was
+// made to that exact path.
+func (m Speedtest) matchesWSLatencyPath(r *http.Request) bool {
+	return m.WSLatencyPath != nil && (*m.WSLatencyPath == "" || r.URL.Path == *m.WSLatencyPath)
+}
+
 // Interface guards
 var (
 	_ caddy.Provisioner     = (*Speedtest)(nil)
@@ -141,9 +304,42 @@ var (
 // “next” handler is ignored and no further processing is done after this
 // handler.
 func (m Speedtest) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	if len(m.AllowedMethods) > 0 && !slices.Contains(m.AllowedMethods, r.Method) {
+		return caddyhttp.Error(
+			http.StatusMethodNotAllowed,
+			fmt.Errorf("method %q is not allowed", r.Method),
+		)
+	}
+
+	if m.sem != nil {
+		select {
+		case m.sem <- struct{}{}:
+			defer func() { <-m.sem }()
+		default:
+			return caddyhttp.Error(
+				http.StatusTooManyRequests,
+				fmt.Errorf("too many concurrent speedtest requests"),
+			)
+		}
+	}
+
+	if m.metricsEnabled() {
+		inFlightRequests.Inc()
+		defer inFlightRequests.Dec()
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		return m.handleGet(w, r)
+		switch {
+		case isWebSocketUpgrade(r) && m.matchesWSLatencyPath(r):
+			return m.handleWSLatency(w, r)
+		case r.URL.Query().Has("ping"):
+			return m.handlePing(w, r)
+		case r.URL.Query().Has("report"):
+			return writeReport(w, newTransportReport(r, 0, 0))
+		default:
+			return m.handleGet(w, r)
+		}
 	case http.MethodPost:
 		return m.handlePost(w, r)
 	default:
@@ -157,32 +353,101 @@ func (m Speedtest) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp
 // “handleGet” handles “GET” requests for the speedtest by serving pseudo-random
 // data of the requested size.
 func (m Speedtest) handleGet(w http.ResponseWriter, r *http.Request) error {
+	start := time.Now()
+
 	// Parse the "bytes" query parameter.
 	bytes, err := humanize.ParseBytes(r.URL.Query().Get("bytes"))
 	if err != nil || bytes == 0 {
+		if m.metricsEnabled() {
+			observeRequest(r, "download", http.StatusBadRequest, 0, start)
+		}
 		return caddyhttp.Error(
 			http.StatusBadRequest,
 			fmt.Errorf(`invalid or missing "bytes" query parameter`),
 		)
 	}
 
-	// Serve pseudo-random data of the requested size.
-	rng := newRandReadSeeker(int64(bytes))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	http.ServeContent(w, r, "", time.Time{}, rng)
+	if m.MaxDownloadBytes > 0 && bytes > m.MaxDownloadBytes {
+		if m.metricsEnabled() {
+			observeRequest(r, "download", http.StatusRequestEntityTooLarge, 0, start)
+		}
+		return caddyhttp.Error(
+			http.StatusRequestEntityTooLarge,
+			fmt.Errorf(
+				"requested %d bytes exceeds max_download of %d bytes",
+				bytes, m.MaxDownloadBytes,
+			),
+		)
+	}
+
+	// Serve pseudo-random data of the requested size, optionally capped to
+	// MaxRateBytesPerSec.
+	var src io.ReadSeeker = newRandReadSeeker(int64(bytes))
+	if m.MaxRateBytesPerSec > 0 {
+		src = newRateLimitedReadSeeker(r.Context(), src, m.MaxRateBytesPerSec)
+	}
+
+	iw := &instrumentedResponseWriter{ResponseWriter: w}
+	iw.Header().Set("Content-Type", "application/octet-stream")
+	if m.AdvertiseH3 && r.ProtoMajor < 3 {
+		iw.Header().Set("Alt-Svc", altSvcHeaderValue(r))
+	}
+	http.ServeContent(iw, r, "", time.Time{}, src)
+
+	if m.metricsEnabled() {
+		status := iw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		observeRequest(r, "download", status, iw.bytes, start)
+	}
 
 	return nil
 }
 
+// “handlePing” handles “GET” requests with a “ping” query parameter by
+// returning a minimal response stamped with the server's time, so that a
+// client can measure round-trip latency (and, with enough samples, jitter).
+func (m Speedtest) handlePing(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("X-Server-Time-Ns", strconv.FormatInt(time.Now().UnixNano(), 10))
+	if clientTime := r.URL.Query().Get("client-time"); clientTime != "" {
+		w.Header().Set("X-Client-Time", clientTime)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 // “handlePost” handles “POST” requests for the speedtest by reading and
 // discarding the request body and reporting the number of bytes received.
 func (m Speedtest) handlePost(w http.ResponseWriter, r *http.Request) error {
+	start := time.Now()
+
 	// Unconditionally send a `100 Continue` response
 	w.WriteHeader(http.StatusContinue)
 
-	// Read and discard the request body
-	size, err := io.Copy(io.Discard, r.Body)
+	// Read and discard the request body, capping it to MaxUploadBytes if
+	// configured.
+	body := r.Body
+	if m.MaxUploadBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(m.MaxUploadBytes))
+	}
+
+	size, err := io.Copy(io.Discard, body)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			if m.metricsEnabled() {
+				observeRequest(r, "upload", http.StatusRequestEntityTooLarge, size, start)
+			}
+			return caddyhttp.Error(
+				http.StatusRequestEntityTooLarge,
+				fmt.Errorf("request body exceeds max_upload of %d bytes", m.MaxUploadBytes),
+			)
+		}
+
+		if m.metricsEnabled() {
+			observeRequest(r, "upload", http.StatusInternalServerError, size, start)
+		}
 		return caddyhttp.Error(
 			http.StatusInternalServerError,
 			fmt.Errorf("failed to read request body: %v", err),
@@ -190,12 +455,23 @@ func (m Speedtest) handlePost(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if size == 0 {
+		if m.metricsEnabled() {
+			observeRequest(r, "upload", http.StatusBadRequest, 0, start)
+		}
 		return caddyhttp.Error(
 			http.StatusBadRequest,
 			fmt.Errorf("request body is empty"),
 		)
 	}
 
+	if m.metricsEnabled() {
+		observeRequest(r, "upload", http.StatusOK, size, start)
+	}
+
+	if r.URL.Query().Has("report") {
+		return writeReport(w, newTransportReport(r, size, time.Since(start)))
+	}
+
 	// Respond with the number of bytes received
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	fmt.Fprintln(w, "Received", humanize.Bytes(uint64(size)), ".")
@@ -11,14 +11,27 @@ package speedtest
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddytest"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go/http3"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -370,3 +383,201 @@ func BenchmarkUpload(b *testing.B) {
 		})
 	}
 }
+
+/////////////////////////
+/// HTTP/3 Benchmarks ///
+/////////////////////////
+
+// “generateSelfSignedCert” creates an in-memory, self-signed TLS
+// certificate valid for “127.0.0.1”, for use by [startH3Server].
+func generateSelfSignedCert(tb testing.TB) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatalf("failed to create certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		tb.Fatalf("failed to load self-signed certificate: %v", err)
+	}
+	return cert
+}
+
+// “h3HandlerAdapter” adapts a [Speedtest] to a plain [http.Handler], the way
+// Caddy's core HTTP server would, by translating a returned
+// [caddyhttp.HandlerError] into the corresponding status code.
+func h3HandlerAdapter(m Speedtest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := m.ServeHTTP(w, r, nil)
+		if err == nil {
+			return
+		}
+
+		var herr caddyhttp.HandlerError
+		if errors.As(err, &herr) {
+			w.WriteHeader(herr.StatusCode)
+			fmt.Fprintln(w, herr.Err)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+}
+
+// “startH3Server” starts an HTTP/3 server for “m” on a loopback UDP port,
+// returning its base URL and a shutdown function.
+func startH3Server(tb testing.TB, m Speedtest) (baseURL string, shutdown func()) {
+	// “m” is never provisioned by Caddy here, so make sure the metric
+	// collectors exist before its handler touches them.
+	initMetrics(prometheus.NewRegistry())
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		tb.Fatalf("failed to listen on UDP: %v", err)
+	}
+
+	server := &http3.Server{
+		Handler: h3HandlerAdapter(m),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{generateSelfSignedCert(tb)},
+			NextProtos:   []string{"h3"},
+		},
+	}
+
+	go func() {
+		if err := server.Serve(udpConn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			tb.Logf("http3 server stopped: %v", err)
+		}
+	}()
+
+	return fmt.Sprint("https://", udpConn.LocalAddr().String()), func() {
+		server.Close()
+		udpConn.Close()
+	}
+}
+
+// “newH3Client” returns an “*http.Client” that speaks HTTP/3 over QUIC,
+// trusting any server certificate (since the test server is self-signed).
+func newH3Client() (client *http.Client, closeTransport func() error) {
+	tr := &http3.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h3"},
+		},
+	}
+	return &http.Client{Transport: tr}, tr.Close
+}
+
+// “BenchmarkDownloadH3” benchmarks download performance over HTTP/3/QUIC,
+// for direct comparison against [BenchmarkDownload] over TCP.
+func BenchmarkDownloadH3(b *testing.B) {
+	baseURL, shutdown := startH3Server(b, Speedtest{})
+	defer shutdown()
+
+	client, closeTransport := newH3Client()
+	defer closeTransport()
+
+	// Warm up the server
+	for range 3 {
+		resp, err := client.Get(fmt.Sprint(baseURL, "/speedtest?bytes=1MB"))
+		if err != nil || resp.StatusCode != 200 {
+			b.Fatalf("failed to warm up server: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	for _, bc := range []struct {
+		sizeStr string
+		sizeInt int64
+	}{
+		{"1MB", 1 * 1000 * 1000},
+		{"10MB", 10 * 1000 * 1000},
+		{"100MB", 100 * 1000 * 1000},
+		{"1GB", 1 * 1000 * 1000 * 1000},
+	} {
+		b.Run(bc.sizeStr, func(b *testing.B) {
+			b.SetBytes(bc.sizeInt)
+			for b.Loop() {
+				resp, err := client.Get(fmt.Sprint(baseURL, "/speedtest?bytes=", bc.sizeStr))
+				if err != nil || resp.StatusCode != 200 {
+					b.Fatalf("failed to download data: %v", err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			b.ReportMetric(0, "ns/op") // Discard the ns/op metric
+		})
+	}
+}
+
+// “BenchmarkUploadH3” benchmarks upload performance over HTTP/3/QUIC, for
+// direct comparison against [BenchmarkUpload] over TCP.
+func BenchmarkUploadH3(b *testing.B) {
+	baseURL, shutdown := startH3Server(b, Speedtest{})
+	defer shutdown()
+
+	client, closeTransport := newH3Client()
+	defer closeTransport()
+
+	// Warm up the server
+	for range 3 {
+		postBody := bytes.NewBuffer(getRandBytes(b, 1*1000*1000))
+		resp, err := client.Post(
+			fmt.Sprint(baseURL, "/speedtest"), "application/octet-stream", postBody,
+		)
+		if err != nil || resp.StatusCode != 200 {
+			b.Fatalf("failed to warm up server: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, bc := range []struct {
+		sizeStr string
+		sizeInt int64
+	}{
+		{"1MB", 1 * 1000 * 1000},
+		{"10MB", 10 * 1000 * 1000},
+		{"100MB", 100 * 1000 * 1000},
+		{"1GB", 1 * 1000 * 1000 * 1000},
+	} {
+		b.Run(bc.sizeStr, func(b *testing.B) {
+			var postBody bytes.Buffer
+			randBytes := getRandBytes(b, bc.sizeInt)
+			postBody.Grow(int(bc.sizeInt))
+
+			b.SetBytes(bc.sizeInt)
+
+			for b.Loop() {
+				postBody.Reset()
+				postBody.Write(randBytes)
+				resp, err := client.Post(
+					fmt.Sprint(baseURL, "/speedtest"), "application/octet-stream", &postBody,
+				)
+				if err != nil || resp.StatusCode != 200 {
+					b.Fatalf("failed to upload data: %v", err)
+				}
+				resp.Body.Close()
+			}
+			b.ReportMetric(0, "ns/op") // Discard the ns/op metric
+		})
+	}
+}